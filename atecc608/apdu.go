@@ -0,0 +1,126 @@
+// armoryctl | https://github.com/f-secure-foundry/armoryctl
+//
+// USB armory Mk II - hardware control tool
+// Copyright (c) F-Secure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+//
+// Links:
+//   http://ww1.microchip.com/downloads/en/DeviceDoc/ATECC608A-CryptoAuthentication-Device-Summary-Data-Sheet-DS40001977B.pdf
+
+package atecc608
+
+import (
+	"errors"
+	"fmt"
+)
+
+// APDU instruction codes, mapping the subset of ATECC commands reachable
+// through the APDU layer onto ISO 7816-4 style INS bytes, so that code
+// written against this layer resembles code written against a smartcard
+// or hardware wallet stack.
+const (
+	InsRead   = 0xb0 // like READ BINARY
+	InsWrite  = 0xd0 // like WRITE BINARY
+	InsSign   = 0x2a // like PERFORM SECURITY OPERATION
+	InsVerify = 0x20 // like VERIFY
+	InsGenKey = 0x46 // like GENERATE ASYMMETRIC KEY PAIR
+)
+
+// APDU represents a command in CLA/INS/P1/P2/data framing.
+type APDU struct {
+	CLA  byte
+	INS  byte
+	P1   byte
+	P2   byte
+	Data []byte
+	// Le is the expected response length, encoded by Bytes only when
+	// non-zero. Session.Execute does not check the response against it.
+	Le byte
+}
+
+// Bytes serializes the APDU into its wire representation:
+// CLA | INS | P1 | P2 | Lc | Data | Le.
+func (a APDU) Bytes() []byte {
+	buf := []byte{a.CLA, a.INS, a.P1, a.P2}
+
+	if len(a.Data) > 0 {
+		buf = append(buf, byte(len(a.Data)))
+		buf = append(buf, a.Data...)
+	}
+
+	if a.Le > 0 {
+		buf = append(buf, a.Le)
+	}
+
+	return buf
+}
+
+// Response represents the result of dispatching an APDU: the returned
+// data plus an ISO 7816-4 style two-byte status word.
+type Response struct {
+	Data []byte
+	SW1  byte
+	SW2  byte
+}
+
+// Status words returned by Session.Execute.
+const (
+	SW1OK             = 0x90
+	SW1DeviceError    = 0x69
+	SW1UnknownINS     = 0x6d
+	SW1TransportError = 0x6f
+)
+
+// OK reports whether the response's status word indicates success
+// (0x9000), following smartcard convention.
+func (r Response) OK() bool {
+	return r.SW1 == SW1OK && r.SW2 == 0x00
+}
+
+// Execute dispatches apdu over the session, translating it into the
+// corresponding ATECC command and wrapping the result (or error) as a
+// Response, so that higher-level code can be written once against the
+// APDU layer and run over any Transport.
+func (s *Session) Execute(apdu APDU) (resp Response, err error) {
+	var opcode byte
+	var param1 [1]byte
+	param2 := [2]byte{apdu.P1, apdu.P2}
+
+	switch apdu.INS {
+	case InsRead:
+		opcode = Cmd["Read"]
+		param1 = [1]byte{apdu.P1}
+	case InsWrite:
+		opcode = Cmd["Write"]
+		param1 = [1]byte{apdu.P1}
+	case InsSign:
+		opcode = Cmd["Sign"]
+		param1 = [1]byte{SignModeExternal}
+		param2 = [2]byte{apdu.P2, 0x00}
+	case InsVerify:
+		opcode = Cmd["Verify"]
+		param1 = [1]byte{VerifyModeExternal}
+	case InsGenKey:
+		opcode = Cmd["GenKey"]
+		param1 = [1]byte{apdu.P1}
+		param2 = [2]byte{apdu.P2, 0x00}
+	default:
+		return Response{SW1: SW1UnknownINS}, fmt.Errorf("apdu: unsupported instruction %#x", apdu.INS)
+	}
+
+	data, err := s.ExecuteCmd(opcode, param1, param2, apdu.Data)
+
+	if err != nil {
+		var statusErr *StatusError
+
+		if errors.As(err, &statusErr) {
+			return Response{SW1: SW1DeviceError, SW2: statusErr.Status}, err
+		}
+
+		return Response{SW1: SW1TransportError}, err
+	}
+
+	return Response{Data: data, SW1: SW1OK}, nil
+}
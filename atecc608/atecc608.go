@@ -16,9 +16,9 @@ package atecc608
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"time"
-	"encoding/hex"
 	"log"
 
 	"github.com/f-secure-foundry/armoryctl/internal"
@@ -51,10 +51,32 @@ const ResponseMinLen = 4
 // (p72, 11. Detailed Command Descriptions, ATECC608A Full Datasheet)
 var Cmd = map[string]byte{
 	"Read":     0x02,
+	"Write":    0x12,
+	"Lock":     0x17,
+	"Nonce":    0x16,
+	"Random":   0x1b,
+	"Counter":  0x24,
+	"GenKey":   0x40,
+	"Sign":     0x41,
+	"ECDH":     0x43,
+	"Verify":   0x45,
+	"AES":      0x51,
 	"SelfTest": 0x77,
 	"SHA256":	0x47,
 }
 
+// Zones, addressed by the zone field of Read/Write/Lock commands.
+// (p58, Table 9-9, Zone Encoding, ATECC608A Full Datasheet)
+const (
+	ZoneConfig = 0x00
+	ZoneOTP    = 0x01
+	ZoneData   = 0x02
+
+	// zoneReadWriteSizeFlag, when set in the zone byte, indicates a
+	// 32-byte transfer rather than the default 4-byte transfer.
+	zoneReadWriteSizeFlag = 0x80
+)
+
 var ShaMode = map[string]byte{
 	"SHA_MODE_SHA256_START": 	0,
 	"SHA_MODE_SHA256_UPDATE": 	1,
@@ -125,6 +147,30 @@ func crc16(data []byte) []byte {
 	return []byte{byte(crc & 0xff), byte(crc >> 8)}
 }
 
+// StatusError wraps a device status/error code returned in a response, so
+// that callers (notably the retry logic in Session.ExecuteCmd) can inspect
+// which status occurred.
+type StatusError struct {
+	Status byte
+}
+
+func (e *StatusError) Error() string {
+	if msg, ok := Status[e.Status]; ok {
+		return msg
+	}
+
+	return fmt.Sprintf("invalid status/error code: %x", e.Status)
+}
+
+// ChecksumError indicates that a response's CRC16 did not match its
+// payload, a wire-level fault distinct from a device-reported StatusError.
+// It is retried by Session.ExecuteCmd the same way as a 0xff status.
+type ChecksumError struct{}
+
+func (e *ChecksumError) Error() string {
+	return "checksum verification failure"
+}
+
 func verifyResponse(res []byte) (data []byte, err error) {
 	// ATECC response packet format:
 	//   count [1] | status/error/response data[variable] | crc16 [2]
@@ -143,7 +189,7 @@ func verifyResponse(res []byte) (data []byte, err error) {
 	crc := res[size:]
 
 	if !bytes.Equal(crc16(payload), crc) {
-		err = fmt.Errorf("checksum verification failure")
+		err = &ChecksumError{}
 		return
 	}
 
@@ -155,10 +201,8 @@ func verifyResponse(res []byte) (data []byte, err error) {
 
 	status := data[0]
 
-	if Status[status] == "" {
-		err = fmt.Errorf("invalid status/error code: %x", status)
-	} else if status != 0x00 && (status <= 0x0f || status == 0xff) {
-		err = fmt.Errorf("%s", Status[status])
+	if status != 0x00 {
+		err = &StatusError{Status: status}
 	}
 
 	return
@@ -185,10 +229,18 @@ func Wake() (err error) {
 		return
 	}
 
-	data, err := verifyResponse(res)
+	_, err = verifyResponse(res)
 
-	if err != nil && data[0] != 0x11 {
-		err = fmt.Errorf("wake-up failed")
+	if err != nil {
+		// Status 0x11 ("after wake, prior to first command") is the
+		// expected response right after waking up, not a failure.
+		var statusErr *StatusError
+
+		if errors.As(err, &statusErr) && statusErr.Status == 0x11 {
+			err = nil
+		} else {
+			err = fmt.Errorf("wake-up failed")
+		}
 	}
 
 	return
@@ -207,23 +259,14 @@ func Idle() {
 	log.Printf("[ATSEND  Idle   addr:%03d %d]\n", I2CAddress, 2)
 }
 
-// ExecuteCmd issues an ATECC command conforming to:
+// executeCmd issues a single raw ATECC command frame over t and returns
+// its verified response, conforming to:
 //   * p55, Table  9-1, ATECC508A Full Datasheet
 //   * p63, Table 10-1, ATECC608A Full Datasheet
 //
-// The wake flag results in the executed command to be issued individually within a
-// Wake() and Sleep() cycle, when the flag is false the caller must take care of
-// waking/sleeping according to its desired command sequence.
-func ExecuteCmd(opcode byte, param1 [1]byte, param2 [2]byte, data []byte, wake bool) (res []byte, err error) {
-	if wake {
-		if err = Wake(); err != nil {
-			return
-		}
-
-		// defer Sleep()
-		defer Idle()
-	}
-
+// Callers must ensure the device is awake before calling executeCmd; see
+// Session.ExecuteCmd.
+func executeCmd(t Transport, opcode byte, param1 [1]byte, param2 [2]byte, data []byte) (res []byte, err error) {
 	// ATECC cmd packet format:
 	//   count [1] | cmd fields [variable] | crc16 [2]
 	//
@@ -242,8 +285,7 @@ func ExecuteCmd(opcode byte, param1 [1]byte, param2 [2]byte, data []byte, wake b
 	cmd = append(cmd, data...)
 	cmd = append(cmd, crc16(cmd)...)
 
-	err = armoryctl.I2CWrite(I2CBus, I2CAddress, CmdAddress, cmd)
-	log.Printf("[ATSEND Execute addr:%03d %d Bytes:[%X]]\n", I2CAddress, CmdAddress, cmd)
+	err = t.Write(CmdAddress, cmd)
 
 	if err != nil {
 		return
@@ -251,15 +293,14 @@ func ExecuteCmd(opcode byte, param1 [1]byte, param2 [2]byte, data []byte, wake b
 
 	time.Sleep(CmdMaxExecutionTime * time.Millisecond)
 
-	_ = armoryctl.I2CWrite(I2CBus, I2CAddress, 0x00, []byte{0x00})
-	log.Printf("[ATSEND wordadr addr:%03d %d]\n", I2CAddress, 0)
+	_ = t.Write(0x00, []byte{0x00})
 
 	// The output FIFO is shared among status, error, and command results.
 	// The first read command is needed to read how many bytes are present
 	// in the output buffer.
 	//
 	// (p64, 10.3 Status/Error Codes, ATECC608A Full Datasheet)
-	resCount, err := armoryctl.I2CRead(I2CBus, I2CAddress, CmdAddress, 1)
+	resCount, err := t.Read(CmdAddress, 1)
 
 	if err != nil {
 		return
@@ -267,7 +308,7 @@ func ExecuteCmd(opcode byte, param1 [1]byte, param2 [2]byte, data []byte, wake b
 
 	// The second read command gets the rest of the response from the
 	// output buffer.
-	res, err = armoryctl.I2CRead(I2CBus, I2CAddress, CmdAddress, uint(resCount[0]))
+	res, err = t.Read(CmdAddress, uint(resCount[0]))
 
 	if err != nil {
 		return
@@ -276,54 +317,11 @@ func ExecuteCmd(opcode byte, param1 [1]byte, param2 [2]byte, data []byte, wake b
 	return verifyResponse(res)
 }
 
-// Execute self test command
-func SHA256(sfmt string, msg string) (res string, err error) {
-	// param1 0x47: performs SHA256 functions.
-
-	// sha256 init
-	data, err := ExecuteCmd(Cmd["SHA256"], [1]byte{ShaMode["SHA_MODE_SHA256_START"]}, [2]byte{0x00, 0x00}, nil, true)
-
-	if err != nil {
-	    return
-	}
-
-	// sha256 update
-	var msg_bytes []byte
-
-	if sfmt == "hex" && len(msg) > 0 {
-	    msg_bytes, err = hex.DecodeString(msg)
-	    if err != nil {
-	        return
-	    }
-	} else if sfmt == "str" {
-	    msg_bytes = []byte(msg)
-	}
-
-	block_cnt := len(msg_bytes)/64
-	for i := 0; i < block_cnt; i++ {
-	    data, err = ExecuteCmd(Cmd["SHA256"], [1]byte{ShaMode["SHA_MODE_SHA256_UPDATE"]}, 
-						    [2]byte{0x40,0}, msg_bytes[i*0x40:(i+1)*0x40], true)
-
-	    if err != nil {
-		return
-	    }
-	}
-
-	//sha256 final
-	data, err = ExecuteCmd(Cmd["SHA256"], [1]byte{ShaMode["SHA_MODE_SHA256_END"]},
-						[2]byte{byte(len(msg_bytes)-block_cnt*64)}, msg_bytes[block_cnt*64:], true)
-
-	if err != nil {
-		return
-	}
-	Sleep()
-	return fmt.Sprintf("SHA256 HexDigest: %x", data), nil
-}
-
-// Execute self test command
-func SelfTest() (res string, err error) {
+// SelfTest runs the device's built-in self test and reports the pass/fail
+// status of each supported test.
+func SelfTest(s *Session) (res string, err error) {
 	// param1 0x3b: performs all available tests.
-	data, err := ExecuteCmd(Cmd["SelfTest"], [1]byte{0x3b}, [2]byte{0x00, 0x00}, nil, true)
+	data, err := s.ExecuteCmd(Cmd["SelfTest"], [1]byte{0x3b}, [2]byte{0x00, 0x00}, nil)
 
 	if err != nil {
 		return
@@ -336,15 +334,15 @@ func SelfTest() (res string, err error) {
 			res += k + ":PASS "
 		}
 	}
-	Sleep()
+
 	return
 }
 
-// Read device serial number and software revision
-func Info() (res string, err error) {
+// Info reads the device serial number and software revision.
+func Info(s *Session) (res string, err error) {
 	// param1 0x80: reads 32 bytes configuration region
 	// param2 0x0000: represents the start address
-	data, err := ExecuteCmd(Cmd["Read"], [1]byte{0x80}, [2]byte{0x00, 0x00}, nil, true)
+	data, err := s.ExecuteCmd(Cmd["Read"], [1]byte{0x80}, [2]byte{0x00, 0x00}, nil)
 
 	if err != nil {
 		return
@@ -357,6 +355,6 @@ func Info() (res string, err error) {
 	serial = append(serial, data[0:4]...)
 	serial = append(serial, data[8:13]...)
 	revision := data[4:8]
-	Sleep()
+
 	return fmt.Sprintf("serial:0x%x revision:0x%x", serial, revision), nil
 }
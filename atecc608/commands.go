@@ -0,0 +1,206 @@
+// armoryctl | https://github.com/f-secure-foundry/armoryctl
+//
+// USB armory Mk II - hardware control tool
+// Copyright (c) F-Secure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+//
+// Links:
+//   http://ww1.microchip.com/downloads/en/DeviceDoc/ATECC608A-CryptoAuthentication-Device-Summary-Data-Sheet-DS40001977B.pdf
+
+package atecc608
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Random modes.
+// (p77, Table 11-21, Random Command, ATECC608A Full Datasheet)
+const (
+	RandomModeSeedUpdate   = 0x00
+	RandomModeNoSeedUpdate = 0x01
+)
+
+// Random returns 32 bytes of output from the device's internal DRBG.
+func Random(s *Session) (rnd [32]byte, err error) {
+	data, err := s.ExecuteCmd(Cmd["Random"], [1]byte{RandomModeSeedUpdate}, [2]byte{0x00, 0x00}, nil)
+
+	if err != nil {
+		return
+	}
+
+	if len(data) != 32 {
+		err = fmt.Errorf("invalid random output length %d, expected 32", len(data))
+		return
+	}
+
+	copy(rnd[:], data)
+
+	return
+}
+
+// RandomReader is an io.Reader sourcing bytes from the device's internal
+// DRBG via Random, so that the ATECC608 can be plugged in wherever a
+// standard random source is expected (e.g. crypto/rand.Reader).
+type RandomReader struct {
+	Session *Session
+}
+
+// Read implements io.Reader.
+func (r RandomReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		var rnd [32]byte
+
+		rnd, err = Random(r.Session)
+
+		if err != nil {
+			return
+		}
+
+		n += copy(p[n:], rnd[:])
+	}
+
+	return
+}
+
+// AES modes.
+// (p91, Table 11-2, AES Command, ATECC608A Full Datasheet)
+const (
+	AESModeEncrypt = 0x00
+	AESModeDecrypt = 0x01
+	AESModeGFM     = 0x03
+)
+
+// AES executes the AES command in mode (AESModeEncrypt, AESModeDecrypt or
+// AESModeGFM) against the key held in slot keyID, operating on the 16-byte
+// input block, and returns the 16-byte result.
+func AES(s *Session, mode byte, keyID byte, input []byte) (output []byte, err error) {
+	if len(input) != 16 {
+		return nil, fmt.Errorf("invalid AES input length %d, expected 16", len(input))
+	}
+
+	return s.ExecuteCmd(Cmd["AES"], [1]byte{mode}, [2]byte{keyID, 0x00}, input)
+}
+
+// ECDH modes.
+// (p74, Table 11-16, ECDH Command, ATECC608A Full Datasheet)
+const (
+	// ECDHModeOutputClear returns the computed shared secret directly in
+	// the command response, in the clear, rather than writing it to
+	// TempKey or a slot.
+	ECDHModeOutputClear = 0x08
+)
+
+// ECDH executes the ECDH command, computing the shared secret between the
+// private key held in slot keyID and the public key peerPub (64-byte
+// X||Y), returning the resulting 32-byte shared secret.
+func ECDH(s *Session, keyID byte, peerPub []byte) (secret []byte, err error) {
+	if len(peerPub) != 64 {
+		return nil, fmt.Errorf("invalid public key length %d, expected 64", len(peerPub))
+	}
+
+	secret, err = s.ExecuteCmd(Cmd["ECDH"], [1]byte{ECDHModeOutputClear}, [2]byte{keyID, 0x00}, peerPub)
+
+	if err != nil {
+		return
+	}
+
+	if len(secret) != 32 {
+		err = fmt.Errorf("invalid shared secret length %d, expected 32", len(secret))
+		return
+	}
+
+	return
+}
+
+// Counter modes.
+// (p71, Table 11-12, Counter Command, ATECC608A Full Datasheet)
+const (
+	CounterModeRead      = 0x00
+	CounterModeIncrement = 0x01
+)
+
+// Counter reads (CounterModeRead) or increments and reads
+// (CounterModeIncrement) the monotonic counter identified by keyID (0 or
+// 1), returning its current value.
+func Counter(s *Session, mode byte, keyID byte) (count uint32, err error) {
+	data, err := s.ExecuteCmd(Cmd["Counter"], [1]byte{mode}, [2]byte{keyID, 0x00}, nil)
+
+	if err != nil {
+		return
+	}
+
+	if len(data) != 4 {
+		err = fmt.Errorf("invalid counter response length %d, expected 4", len(data))
+		return
+	}
+
+	count = binary.LittleEndian.Uint32(data)
+
+	return
+}
+
+// zoneAddress computes the 16-bit address field (param2) addressing a
+// given zone/slot/block/offset combination.
+// (p58, Table 9-9, Address Encoding, ATECC608A Full Datasheet)
+func zoneAddress(zone byte, slot byte, block byte, offset byte) [2]byte {
+	var addr uint16
+
+	switch zone &^ zoneReadWriteSizeFlag {
+	case ZoneConfig, ZoneOTP:
+		addr = uint16(block)<<3 | uint16(offset&0x07)
+	case ZoneData:
+		addr = uint16(slot)<<3 | uint16(offset&0x07)
+		addr |= uint16(block) << 8
+	}
+
+	return [2]byte{byte(addr), byte(addr >> 8)}
+}
+
+// ReadZone reads a word of n bytes (4 or 32) from zone at the given
+// slot/block/offset, automatically selecting the matching transfer size.
+func ReadZone(s *Session, zone byte, slot byte, block byte, offset byte, n int) (data []byte, err error) {
+	z := zone
+
+	switch n {
+	case 32:
+		z |= zoneReadWriteSizeFlag
+	case 4:
+		// use the 4-byte transfer size implied by the bare zone value
+	default:
+		return nil, fmt.Errorf("invalid read length %d, must be 4 or 32", n)
+	}
+
+	return s.ExecuteCmd(Cmd["Read"], [1]byte{z}, zoneAddress(zone, slot, block, offset), nil)
+}
+
+// WriteZone writes data (4 or 32 bytes) to zone at the given
+// slot/block/offset. mac, when non-nil, must be the 32-byte authenticating
+// MAC required by slots configured for MAC-authenticated writes.
+func WriteZone(s *Session, zone byte, slot byte, block byte, offset byte, data []byte, mac []byte) (err error) {
+	z := zone
+	payload := data
+
+	switch len(data) {
+	case 32:
+		z |= zoneReadWriteSizeFlag
+	case 4:
+		// use the 4-byte transfer size implied by the bare zone value
+	default:
+		return fmt.Errorf("invalid write length %d, must be 4 or 32", len(data))
+	}
+
+	if mac != nil {
+		if len(mac) != 32 {
+			return fmt.Errorf("invalid MAC length %d, expected 32", len(mac))
+		}
+
+		payload = append(append([]byte{}, data...), mac...)
+	}
+
+	_, err = s.ExecuteCmd(Cmd["Write"], [1]byte{z}, zoneAddress(zone, slot, block, offset), payload)
+
+	return
+}
@@ -0,0 +1,350 @@
+// armoryctl | https://github.com/f-secure-foundry/armoryctl
+//
+// USB armory Mk II - hardware control tool
+// Copyright (c) F-Secure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+//
+// Links:
+//   http://ww1.microchip.com/downloads/en/DeviceDoc/ATECC608A-CryptoAuthentication-Device-Summary-Data-Sheet-DS40001977B.pdf
+
+package atecc608
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ConfigZoneSize is the size in bytes of the ATECC608 configuration zone.
+// (p19, Table 3-1, Configuration Zone, ATECC608A Full Datasheet)
+const ConfigZoneSize = 128
+
+// SlotCount is the number of data/key slots addressable through
+// SlotConfig/KeyConfig.
+const SlotCount = 16
+
+// Offsets, in the 128-byte configuration zone, of the per-slot
+// configuration words.
+// (p20, Table 3-2, Configuration Zone Layout, ATECC608A Full Datasheet)
+const (
+	slotConfigOffset = 20
+	keyConfigOffset  = 96
+)
+
+// SlotConfig represents the 2-byte SlotConfig word controlling access
+// permissions for a single slot.
+// (p24, Table 3-4, SlotConfig Bit Definitions, ATECC608A Full Datasheet)
+type SlotConfig struct {
+	ReadKey     byte // bits [3:0]  - slot usable to authorize reads of this slot
+	NoMac       bool // bit  4      - disable MAC/HMAC use of this slot as input key
+	LimitedUse  bool // bit  5      - consume a use counter on each use
+	EncryptRead bool // bit  6      - require encrypted reads
+	IsSecret    bool // bit  7      - slot contents cannot be read in the clear
+	WriteKey    byte // bits [11:8] - slot usable to authorize writes of this slot
+	WriteConfig byte // bits [15:12] - write permission (Always/Never/Encrypt/...)
+}
+
+// Pack encodes SlotConfig into its 2-byte little-endian wire representation.
+func (s SlotConfig) Pack() [2]byte {
+	lo := s.ReadKey & 0x0f
+	if s.NoMac {
+		lo |= 1 << 4
+	}
+	if s.LimitedUse {
+		lo |= 1 << 5
+	}
+	if s.EncryptRead {
+		lo |= 1 << 6
+	}
+	if s.IsSecret {
+		lo |= 1 << 7
+	}
+
+	hi := s.WriteKey & 0x0f
+	hi |= (s.WriteConfig & 0x0f) << 4
+
+	return [2]byte{lo, hi}
+}
+
+// KeyConfig represents the 2-byte KeyConfig word controlling the
+// cryptographic use of a single slot.
+// (p26, Table 3-5, KeyConfig Bit Definitions, ATECC608A Full Datasheet)
+type KeyConfig struct {
+	Private           bool // bit  0      - slot holds a private key
+	PubInfo           bool // bit  1      - public key validity is enforced
+	KeyType           byte // bits [4:2]  - 4 = ECC P-256, 6 = AES, 7 = generic data
+	Lockable          bool // bit  5      - slot can be individually locked
+	ReqRandom         bool // bit  6      - a random nonce is required before use
+	ReqAuth           bool // bit  7      - use of the slot requires prior authorization
+	AuthKey           byte // bits [11:8] - slot holding the authorizing key
+	PersistentDisable bool // bit  12     - disables persistent latch check
+	RFU               bool // bit  13     - reserved, must be zero
+	X509Id            byte // bits [15:14] - index into the X.509 format table
+}
+
+// Pack encodes KeyConfig into its 2-byte little-endian wire representation.
+func (k KeyConfig) Pack() [2]byte {
+	lo := byte(0)
+	if k.Private {
+		lo |= 1 << 0
+	}
+	if k.PubInfo {
+		lo |= 1 << 1
+	}
+	lo |= (k.KeyType & 0x07) << 2
+	if k.Lockable {
+		lo |= 1 << 5
+	}
+	if k.ReqRandom {
+		lo |= 1 << 6
+	}
+	if k.ReqAuth {
+		lo |= 1 << 7
+	}
+
+	hi := k.AuthKey & 0x0f
+	if k.PersistentDisable {
+		hi |= 1 << 4
+	}
+	hi |= (k.X509Id & 0x03) << 6
+
+	return [2]byte{lo, hi}
+}
+
+// KeyType values for KeyConfig.KeyType.
+const (
+	KeyTypeAES  = 0x06
+	KeyTypeECC  = 0x04
+	KeyTypeData = 0x07
+)
+
+// ReadConfigZone reads and returns the full 128-byte configuration zone.
+func ReadConfigZone(s *Session) (config []byte, err error) {
+	config = make([]byte, 0, ConfigZoneSize)
+
+	for block := byte(0); block < ConfigZoneSize/32; block++ {
+		data, err := ReadZone(s, ZoneConfig, 0, block, 0, 32)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config = append(config, data...)
+	}
+
+	return
+}
+
+// WriteConfigZone writes the given 128-byte configuration, skipping the
+// read-only bytes at offset 0-15 (serial number and revision number among
+// them): the rest of block 0 is written as four 4-byte words, blocks 1-3 as
+// whole 32-byte blocks.
+func WriteConfigZone(s *Session, config []byte) (err error) {
+	if len(config) != ConfigZoneSize {
+		return fmt.Errorf("invalid configuration length %d, expected %d", len(config), ConfigZoneSize)
+	}
+
+	// Bytes 0-15 of block 0 (SN/RevNum and related fields) are
+	// read-only; write only the remaining four 4-byte words of block 0.
+	for word := byte(4); word < 8; word++ {
+		offset := int(word) * 4
+
+		if err = WriteZone(s, ZoneConfig, 0, 0, word, config[offset:offset+4], nil); err != nil {
+			return
+		}
+	}
+
+	for block := byte(1); block < ConfigZoneSize/32; block++ {
+		offset := int(block) * 32
+
+		if err = WriteZone(s, ZoneConfig, 0, block, 0, config[offset:offset+32], nil); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// WriteSlotConfig writes the SlotConfig word for slot into config, a
+// 128-byte configuration zone buffer previously obtained from
+// ReadConfigZone or a profile template.
+func WriteSlotConfig(config []byte, slot byte, sc SlotConfig) (err error) {
+	if int(slot) >= SlotCount {
+		return fmt.Errorf("invalid slot %d", slot)
+	}
+
+	if len(config) != ConfigZoneSize {
+		return fmt.Errorf("invalid configuration length %d, expected %d", len(config), ConfigZoneSize)
+	}
+
+	word := sc.Pack()
+	offset := slotConfigOffset + int(slot)*2
+	copy(config[offset:offset+2], word[:])
+
+	return
+}
+
+// WriteKeyConfig writes the KeyConfig word for slot into config, a
+// 128-byte configuration zone buffer previously obtained from
+// ReadConfigZone or a profile template.
+func WriteKeyConfig(config []byte, slot byte, kc KeyConfig) (err error) {
+	if int(slot) >= SlotCount {
+		return fmt.Errorf("invalid slot %d", slot)
+	}
+
+	if len(config) != ConfigZoneSize {
+		return fmt.Errorf("invalid configuration length %d, expected %d", len(config), ConfigZoneSize)
+	}
+
+	word := kc.Pack()
+	offset := keyConfigOffset + int(slot)*2
+	copy(config[offset:offset+2], word[:])
+
+	return
+}
+
+// Lock command modes.
+// (p91, Table 11-24, Lock Command, ATECC608A Full Datasheet)
+const (
+	// LockModeZoneConfig locks the configuration zone.
+	LockModeZoneConfig = 0x00
+	// LockModeZoneDataOTP locks the data and OTP zones together.
+	LockModeZoneDataOTP = 0x01
+	// LockModeNoCRC skips the mandatory summary check against the
+	// zone's current CRC, which this package does not compute.
+	LockModeNoCRC = 0x80
+)
+
+// LockZone permanently locks zone (ZoneConfig or ZoneData), preventing any
+// further writes to it. This operation is irreversible.
+func LockZone(s *Session, zone byte) (err error) {
+	var mode byte
+
+	switch zone {
+	case ZoneConfig:
+		mode = LockModeZoneConfig
+	case ZoneData:
+		mode = LockModeZoneDataOTP
+	default:
+		return fmt.Errorf("invalid zone %#x for LockZone", zone)
+	}
+
+	mode |= LockModeNoCRC
+
+	_, err = s.ExecuteCmd(Cmd["Lock"], [1]byte{mode}, [2]byte{0x00, 0x00}, nil)
+	return
+}
+
+// Profile builds a complete 128-byte configuration zone template for a
+// predefined use case, ready to be passed to WriteConfigZone.
+type Profile func(base []byte) (config []byte, err error)
+
+// Profiles are predefined SlotConfig/KeyConfig layouts covering common
+// provisioning scenarios, modeled after the profiles shipped with
+// Microchip's cryptoauthlib.
+var Profiles = map[string]Profile{
+	"generic-ECC": profileGenericECC,
+	"TLS-client":  profileTLSClient,
+	"signed-boot": profileSignedBoot,
+}
+
+// profileTemplate returns a copy of base with slot 0 configured as an ECC
+// P-256 private key usable for internal Sign operations, and the
+// remaining slots left at their factory defaults.
+func profileTemplate(base []byte) (config []byte, err error) {
+	if len(base) != ConfigZoneSize {
+		return nil, fmt.Errorf("invalid base configuration length %d, expected %d", len(base), ConfigZoneSize)
+	}
+
+	config = make([]byte, ConfigZoneSize)
+	copy(config, base)
+
+	if err = WriteSlotConfig(config, 0, SlotConfig{WriteConfig: 0x00}); err != nil {
+		return
+	}
+
+	if err = WriteKeyConfig(config, 0, KeyConfig{Private: true, Lockable: true, KeyType: KeyTypeECC}); err != nil {
+		return
+	}
+
+	return
+}
+
+// profileGenericECC provisions slot 0 as a general purpose ECC P-256
+// private key, with no further constraints.
+func profileGenericECC(base []byte) (config []byte, err error) {
+	return profileTemplate(base)
+}
+
+// profileTLSClient provisions slot 0 as an ECC P-256 private key used for
+// TLS client authentication, requiring a random nonce before each Sign.
+func profileTLSClient(base []byte) (config []byte, err error) {
+	config, err = profileTemplate(base)
+
+	if err != nil {
+		return
+	}
+
+	err = WriteKeyConfig(config, 0, KeyConfig{Private: true, Lockable: true, KeyType: KeyTypeECC, ReqRandom: true})
+
+	return
+}
+
+// profileSignedBoot provisions slot 0 as an ECC P-256 private key intended
+// to verify signed boot images, marking it non-secret so its public key
+// can always be recovered via GenKeyModePublic.
+func profileSignedBoot(base []byte) (config []byte, err error) {
+	config, err = profileTemplate(base)
+
+	if err != nil {
+		return
+	}
+
+	err = WriteSlotConfig(config, 0, SlotConfig{IsSecret: false, WriteConfig: 0x00})
+
+	return
+}
+
+// Diff describes the byte-level differences between two configuration
+// zones, as produced by DryRun.
+type Diff struct {
+	Offset   int
+	Current  byte
+	Proposed byte
+}
+
+// DryRun computes the profile named by name against the device's current
+// configuration zone and returns the byte-level differences, without
+// writing or locking anything.
+func DryRun(s *Session, name string) (diffs []Diff, config []byte, err error) {
+	profile, ok := Profiles[name]
+
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown profile %q", name)
+	}
+
+	current, err := ReadConfigZone(s)
+
+	if err != nil {
+		return
+	}
+
+	config, err = profile(current)
+
+	if err != nil {
+		return
+	}
+
+	if bytes.Equal(current, config) {
+		return
+	}
+
+	for i := range config {
+		if current[i] != config[i] {
+			diffs = append(diffs, Diff{Offset: i, Current: current[i], Proposed: config[i]})
+		}
+	}
+
+	return
+}
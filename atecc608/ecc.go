@@ -0,0 +1,230 @@
+// armoryctl | https://github.com/f-secure-foundry/armoryctl
+//
+// USB armory Mk II - hardware control tool
+// Copyright (c) F-Secure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+//
+// Links:
+//   http://ww1.microchip.com/downloads/en/DeviceDoc/ATECC608A-CryptoAuthentication-Device-Summary-Data-Sheet-DS40001977B.pdf
+
+package atecc608
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// GenKey modes.
+// (p79, Table 11-22, GenKey Command, ATECC608A Full Datasheet)
+const (
+	// GenKeyModePrivate generates a new random private key inside the
+	// given slot and returns the corresponding public key.
+	GenKeyModePrivate = 0x04
+	// GenKeyModePublic computes and returns the public key associated
+	// with an existing private key, without modifying slot contents.
+	GenKeyModePublic = 0x00
+)
+
+// Nonce modes.
+// (p81, Table 11-29, Nonce Command, ATECC608A Full Datasheet)
+const (
+	// NonceModePassthrough loads TempKey directly with the 32 bytes of
+	// input data, bypassing the chip's internal RNG.
+	NonceModePassthrough = 0x03
+)
+
+// Sign modes.
+// (p84, Table 11-33, Sign Command, ATECC608A Full Datasheet)
+const (
+	// SignModeExternal signs the digest currently held in TempKey using
+	// the private key in the slot identified by param2.
+	SignModeExternal = 0x80
+)
+
+// Verify modes.
+// (p89, Table 11-39, Verify Command, ATECC608A Full Datasheet)
+const (
+	// VerifyModeExternal verifies the signature in the input data
+	// against the digest in TempKey, using the public key supplied in
+	// the input data rather than one stored on the device.
+	VerifyModeExternal = 0x02
+)
+
+// VerifyKeyTypeP256 is the param2 KeyType value identifying a P-256 ECC
+// public key to the Verify command's external mode.
+// (p89, Table 11-39, Verify Command, ATECC608A Full Datasheet)
+const VerifyKeyTypeP256 = 0x0004
+
+// PublicKey represents the ECDSA P-256 public key associated with a
+// PrivateKey held on the ATECC608.
+type PublicKey struct {
+	*ecdsa.PublicKey
+}
+
+// PrivateKey represents an ECDSA P-256 private key whose material never
+// leaves the ATECC608, identified by the data slot it is stored in.
+//
+// PrivateKey implements crypto.Signer, allowing slot-backed keys to be used
+// directly with packages such as crypto/tls and crypto/x509.
+type PrivateKey struct {
+	// Slot is the data slot holding the private key.
+	Slot byte
+
+	session *Session
+	pub     *PublicKey
+}
+
+// GenKey issues the GenKey command against slot, either generating a new
+// private key (GenKeyModePrivate) or computing the public key for an
+// existing one (GenKeyModePublic), returning the 64-byte X||Y public key
+// point.
+func GenKey(s *Session, mode byte, slot byte) (pub []byte, err error) {
+	return s.ExecuteCmd(Cmd["GenKey"], [1]byte{mode}, [2]byte{slot, 0x00}, nil)
+}
+
+// Nonce loads TempKey with digest, bypassing the device's internal RNG, so
+// that a subsequent Sign or Verify operates on a digest computed by the
+// caller.
+func Nonce(s *Session, digest [32]byte) (err error) {
+	_, err = s.ExecuteCmd(Cmd["Nonce"], [1]byte{NonceModePassthrough}, [2]byte{0x00, 0x00}, digest[:])
+	return
+}
+
+// Sign issues the Sign command against slot, returning the raw 64-byte
+// R||S signature of the digest currently held in TempKey.
+func Sign(s *Session, slot byte) (sig []byte, err error) {
+	return s.ExecuteCmd(Cmd["Sign"], [1]byte{SignModeExternal}, [2]byte{slot, 0x00}, nil)
+}
+
+// Verify issues the Verify command, checking sig (raw R||S) against the
+// digest currently held in TempKey and the public key pub (raw X||Y). A
+// signature miscompare is reported as (false, nil), not an error; only a
+// genuine command/transport fault is returned as err.
+func Verify(s *Session, sig []byte, pub []byte) (ok bool, err error) {
+	data := append(append([]byte{}, sig...), pub...)
+
+	_, err = s.ExecuteCmd(Cmd["Verify"], [1]byte{VerifyModeExternal}, [2]byte{VerifyKeyTypeP256, 0x00}, data)
+
+	if err != nil {
+		var statusErr *StatusError
+
+		if errors.As(err, &statusErr) && statusErr.Status == 0x01 {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// pointToPublicKey converts the 64-byte X||Y point returned by GenKey into
+// a PublicKey.
+func pointToPublicKey(point []byte) (*PublicKey, error) {
+	if len(point) != 64 {
+		return nil, errors.New("atecc608: invalid public key point length")
+	}
+
+	return &PublicKey{
+		PublicKey: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[:32]),
+			Y:     new(big.Int).SetBytes(point[32:]),
+		},
+	}, nil
+}
+
+// NewPrivateKey returns a PrivateKey backed by the existing key material in
+// slot, caching the public key computed by the device. The session is
+// retained and reused for subsequent Sign calls.
+func NewPrivateKey(s *Session, slot byte) (priv *PrivateKey, err error) {
+	point, err := GenKey(s, GenKeyModePublic, slot)
+
+	if err != nil {
+		return
+	}
+
+	pub, err := pointToPublicKey(point)
+
+	if err != nil {
+		return
+	}
+
+	return &PrivateKey{Slot: slot, session: s, pub: pub}, nil
+}
+
+// GeneratePrivateKey generates a new random private key inside slot and
+// returns a PrivateKey wrapping it. The session is retained and reused for
+// subsequent Sign calls.
+func GeneratePrivateKey(s *Session, slot byte) (priv *PrivateKey, err error) {
+	point, err := GenKey(s, GenKeyModePrivate, slot)
+
+	if err != nil {
+		return
+	}
+
+	pub, err := pointToPublicKey(point)
+
+	if err != nil {
+		return
+	}
+
+	return &PrivateKey{Slot: slot, session: s, pub: pub}, nil
+}
+
+// Public returns the public key corresponding to the private key held in
+// the device slot, implementing crypto.Signer.
+//
+// It returns the unwrapped *ecdsa.PublicKey rather than PublicKey, since
+// packages such as crypto/x509 type-switch on the concrete dynamic type and
+// do not see through an embedding wrapper.
+func (p *PrivateKey) Public() crypto.PublicKey {
+	return p.pub.PublicKey
+}
+
+// ecdsaSignature mirrors the ASN.1 structure expected by crypto/ecdsa and
+// consumers such as crypto/x509 and crypto/tls.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// Sign loads digest into TempKey and signs it with the private key held in
+// p.Slot, returning an ASN.1 DER-encoded ECDSA signature as produced by
+// crypto/ecdsa, implementing crypto.Signer.
+//
+// rand is ignored, as the ATECC608 uses its own internal RNG and TRNG
+// seeding when required by the Sign command.
+func (p *PrivateKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	if len(digest) != 32 {
+		return nil, errors.New("atecc608: digest must be 32 bytes")
+	}
+
+	var d [32]byte
+	copy(d[:], digest)
+
+	if err = Nonce(p.session, d); err != nil {
+		return
+	}
+
+	raw, err := Sign(p.session, p.Slot)
+
+	if err != nil {
+		return
+	}
+
+	if len(raw) != 64 {
+		return nil, errors.New("atecc608: invalid signature length")
+	}
+
+	return asn1.Marshal(ecdsaSignature{
+		R: new(big.Int).SetBytes(raw[:32]),
+		S: new(big.Int).SetBytes(raw[32:]),
+	})
+}
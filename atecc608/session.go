@@ -0,0 +1,183 @@
+// armoryctl | https://github.com/f-secure-foundry/armoryctl
+//
+// USB armory Mk II - hardware control tool
+// Copyright (c) F-Secure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+//
+// Links:
+//   http://ww1.microchip.com/downloads/en/DeviceDoc/ATECC608A-CryptoAuthentication-Device-Summary-Data-Sheet-DS40001977B.pdf
+
+package atecc608
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// MaxRetries is the maximum number of retries Session.ExecuteCmd will
+// attempt for a single command before giving up and returning the last
+// error encountered.
+var MaxRetries = 5
+
+// RetryBackoff computes how long to wait before retrying cmd after
+// lastErr, on the given attempt (starting at 0). It is consulted by
+// Session.ExecuteCmd and may be overridden by callers that need different
+// timing, following the same pattern as acme.Client.RetryBackoff.
+//
+// The default is a truncated exponential backoff, capped at ~2s, with
+// jitter.
+var RetryBackoff = func(attempt int, cmd byte, lastErr error) time.Duration {
+	backoff := 50 * time.Millisecond * time.Duration(uint(1)<<uint(attempt))
+
+	if max := 2 * time.Second; backoff > max {
+		backoff = max
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// tWatchdogRecover is the minimum time to wait, after issuing Idle in
+// response to an imminent watchdog timeout, before re-waking the device.
+// (p47, 7.1 I/O Conditions, ATECC608A Full Datasheet)
+const tWatchdogRecover = 1500 * time.Millisecond
+
+// SessionState represents the device power state tracked by a Session.
+type SessionState int
+
+// Device power states.
+const (
+	StateSleeping SessionState = iota
+	StateAwake
+	StateIdle
+)
+
+// Session represents a sequence of commands issued to the device between a
+// Wake and a Sleep. It tracks power state so that callers no longer need to
+// manage Wake/Idle/Sleep themselves around every single command.
+type Session struct {
+	transport Transport
+	state     SessionState
+}
+
+// Open wakes the device over the default I2C transport and returns a
+// Session ready to execute commands. Callers must Close the session once
+// done, to put the device back to sleep.
+func Open() (s *Session, err error) {
+	return OpenTransport(I2CTransport{})
+}
+
+// OpenTransport wakes the device over t and returns a Session ready to
+// execute commands, allowing callers to target a transport other than the
+// default I2C one (e.g. a SWI part or a CryptoAuth USB kit).
+func OpenTransport(t Transport) (s *Session, err error) {
+	s = &Session{transport: t}
+
+	if err = t.Wake(); err != nil {
+		return nil, err
+	}
+
+	s.state = StateAwake
+
+	return
+}
+
+// Close puts the device to sleep, ending the session.
+func (s *Session) Close() (err error) {
+	s.transport.Sleep()
+	s.state = StateSleeping
+	return
+}
+
+// Idle puts the device in idle mode between commands, preserving TempKey
+// and other volatile state without the latency of a full Wake for the next
+// command.
+func (s *Session) Idle() {
+	s.transport.Idle()
+	s.state = StateIdle
+}
+
+// wake re-issues a device Wake if the session had been put to sleep.
+// Commands issued from idle do not require a new Wake, as idle mode
+// preserves TempKey and other volatile state.
+func (s *Session) wake() (err error) {
+	if s.state == StateSleeping {
+		if err = s.transport.Wake(); err != nil {
+			return
+		}
+	}
+
+	s.state = StateAwake
+
+	return
+}
+
+// ExecuteCmd issues an ATECC command within the session, auto-waking the
+// device if necessary and leaving it idle once the command completes.
+//
+// Transient faults are retried up to MaxRetries times, waiting
+// RetryBackoff between attempts: a ChecksumError or a 0xff status (CRC/other
+// comms error) is simply retransmitted, 0x11 (device not yet awake)
+// triggers a re-Wake before retransmitting, and 0xee (watchdog about to
+// expire) triggers an Idle, a wait of tWatchdogRecover, a re-Wake, and then
+// retransmission.
+// (p63, Table 10-1, ATECC608A Full Datasheet)
+func (s *Session) ExecuteCmd(opcode byte, param1 [1]byte, param2 [2]byte, data []byte) (res []byte, err error) {
+	if err = s.wake(); err != nil {
+		return
+	}
+
+	defer s.Idle()
+
+	for attempt := 0; ; attempt++ {
+		res, err = executeCmd(s.transport, opcode, param1, param2, data)
+
+		if err == nil {
+			return
+		}
+
+		if attempt >= MaxRetries {
+			return
+		}
+
+		lastErr := err
+
+		var statusErr *StatusError
+		var checksumErr *ChecksumError
+
+		switch {
+		case errors.As(err, &checksumErr):
+			// Wire-level CRC mismatch: retransmit as-is, same as a
+			// device-reported 0xff status.
+
+		case errors.As(err, &statusErr):
+			switch statusErr.Status {
+			case 0xff:
+				// CRC or other communications error: retransmit as-is.
+			case 0x11:
+				// Device not yet awake: re-issue Wake before retransmitting.
+				if err = s.transport.Wake(); err != nil {
+					return
+				}
+			case 0xee:
+				// Watchdog about to expire: Idle, wait it out, then re-Wake
+				// before retransmitting.
+				s.transport.Idle()
+				time.Sleep(tWatchdogRecover)
+
+				if err = s.transport.Wake(); err != nil {
+					return
+				}
+			default:
+				return
+			}
+
+		default:
+			return
+		}
+
+		time.Sleep(RetryBackoff(attempt, opcode, lastErr))
+	}
+}
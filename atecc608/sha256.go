@@ -0,0 +1,135 @@
+// armoryctl | https://github.com/f-secure-foundry/armoryctl
+//
+// USB armory Mk II - hardware control tool
+// Copyright (c) F-Secure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+//
+// Links:
+//   http://ww1.microchip.com/downloads/en/DeviceDoc/ATECC608A-CryptoAuthentication-Device-Summary-Data-Sheet-DS40001977B.pdf
+
+package atecc608
+
+import (
+	"hash"
+)
+
+const (
+	sha256BlockSize = 64
+	sha256Size      = 32
+)
+
+// atSHA256 offloads SHA-256 computation to the device's SHA256 command,
+// implementing hash.Hash so it can be used with io.Copy and other standard
+// hash.Hash consumers.
+type atSHA256 struct {
+	session *Session
+	buf     []byte
+	started bool
+	err     error
+}
+
+// NewSHA256 returns a hash.Hash that streams writes to the device's
+// SHA256 command within session: SHA_MODE_SHA256_START is issued on the
+// first Write, every full 64-byte block is flushed with
+// SHA_MODE_SHA256_UPDATE as it accumulates, and the final (possibly
+// partial) block is consumed with SHA_MODE_SHA256_END on Sum.
+func NewSHA256(s *Session) hash.Hash {
+	return &atSHA256{session: s}
+}
+
+func (h *atSHA256) start() (err error) {
+	if h.err != nil {
+		return h.err
+	}
+
+	if h.started {
+		return
+	}
+
+	_, err = h.session.ExecuteCmd(Cmd["SHA256"], [1]byte{ShaMode["SHA_MODE_SHA256_START"]}, [2]byte{0x00, 0x00}, nil)
+
+	if err != nil {
+		h.err = err
+		return
+	}
+
+	h.started = true
+
+	return
+}
+
+// Write implements hash.Hash / io.Writer, buffering data and flushing
+// complete 64-byte blocks to the device as they accumulate. It returns
+// either len(p) with a nil error, or 0 with the device error, after which
+// the caller should treat the hash as unusable.
+func (h *atSHA256) Write(p []byte) (n int, err error) {
+	if err = h.start(); err != nil {
+		return 0, err
+	}
+
+	h.buf = append(h.buf, p...)
+
+	for len(h.buf) >= sha256BlockSize {
+		block := h.buf[:sha256BlockSize]
+
+		if _, err = h.session.ExecuteCmd(Cmd["SHA256"], [1]byte{ShaMode["SHA_MODE_SHA256_UPDATE"]}, [2]byte{sha256BlockSize, 0x00}, block); err != nil {
+			h.err = err
+			return
+		}
+
+		h.buf = h.buf[sha256BlockSize:]
+	}
+
+	return len(p), nil
+}
+
+// Sum appends the SHA-256 digest of all data written so far to b.
+//
+// Unlike a software hash.Hash, Sum finalizes the device's SHA256 context
+// (SHA_MODE_SHA256_END consumes it) and cannot be called more than once
+// without an intervening Reset.
+//
+// hash.Hash.Sum has no error return, so a device error here cannot be
+// reported as a zero-valued digest indistinguishable from a real one;
+// instead Sum panics, and Err can be used beforehand to check the hash's
+// state without risking a panic.
+func (h *atSHA256) Sum(b []byte) []byte {
+	if err := h.start(); err != nil {
+		panic("atecc608: SHA256 hash is unusable: " + err.Error())
+	}
+
+	data, err := h.session.ExecuteCmd(Cmd["SHA256"], [1]byte{ShaMode["SHA_MODE_SHA256_END"]}, [2]byte{byte(len(h.buf)), 0x00}, h.buf)
+
+	if err != nil {
+		h.err = err
+		panic("atecc608: SHA256 hash is unusable: " + err.Error())
+	}
+
+	return append(b, data...)
+}
+
+// Err reports the first device error encountered by a prior Write or Sum,
+// if any. Once set, the hash is unusable until Reset.
+func (h *atSHA256) Err() error {
+	return h.err
+}
+
+// Reset discards any buffered data and clears any recorded error, so that
+// the next Write starts a new SHA256 context on the device.
+func (h *atSHA256) Reset() {
+	h.buf = nil
+	h.started = false
+	h.err = nil
+}
+
+// Size returns the number of bytes Sum will append: 32.
+func (h *atSHA256) Size() int {
+	return sha256Size
+}
+
+// BlockSize returns the hash's underlying block size: 64.
+func (h *atSHA256) BlockSize() int {
+	return sha256BlockSize
+}
@@ -0,0 +1,67 @@
+// armoryctl | https://github.com/f-secure-foundry/armoryctl
+//
+// USB armory Mk II - hardware control tool
+// Copyright (c) F-Secure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+//
+// Links:
+//   http://ww1.microchip.com/downloads/en/DeviceDoc/ATECC608A-CryptoAuthentication-Device-Summary-Data-Sheet-DS40001977B.pdf
+
+package atecc608
+
+import (
+	"github.com/f-secure-foundry/armoryctl/internal"
+)
+
+// Transport abstracts the physical command channel to an ATECC608,
+// decoupling the command protocol (executeCmd, Session, and everything
+// built on top of it) from the bus it is carried over. This allows the
+// same higher-level code to run unmodified against the USB armory's I2C
+// bus, a SWI single-wire part, or a Microchip CryptoAuth USB development
+// kit, so development can happen against a kit on a workstation before
+// deploying to the target.
+type Transport interface {
+	// Write sends data to the device, addressed by word.
+	Write(word uint8, data []byte) error
+	// Read reads n bytes from the device, addressed by word.
+	Read(word uint8, n uint) ([]byte, error)
+	// Wake issues a device wake-up, always needed before starting a new
+	// command session.
+	Wake() error
+	// Idle puts the device in idle mode between commands.
+	Idle()
+	// Sleep puts the device in sleep mode, ending a command session.
+	Sleep()
+}
+
+// I2CTransport is the default Transport, communicating with the device
+// over the I2C bus identified by the package-level I2CBus/I2CAddress
+// variables, as used by the USB armory Mk II.
+type I2CTransport struct{}
+
+// Write implements Transport.
+func (I2CTransport) Write(word uint8, data []byte) error {
+	return armoryctl.I2CWrite(I2CBus, I2CAddress, word, data)
+}
+
+// Read implements Transport.
+func (I2CTransport) Read(word uint8, n uint) ([]byte, error) {
+	return armoryctl.I2CRead(I2CBus, I2CAddress, word, n)
+}
+
+// Wake implements Transport.
+func (I2CTransport) Wake() error {
+	return Wake()
+}
+
+// Idle implements Transport.
+func (I2CTransport) Idle() {
+	Idle()
+}
+
+// Sleep implements Transport.
+func (I2CTransport) Sleep() {
+	Sleep()
+}
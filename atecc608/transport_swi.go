@@ -0,0 +1,206 @@
+// armoryctl | https://github.com/f-secure-foundry/armoryctl
+//
+// USB armory Mk II - hardware control tool
+// Copyright (c) F-Secure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+//
+// Links:
+//   http://ww1.microchip.com/downloads/en/DeviceDoc/ATECC608A-CryptoAuthentication-Device-Summary-Data-Sheet-DS40001977B.pdf
+
+// SWITransport bit-bangs its 1-7us bit cells through userspace
+// GPIOSet/GPIOGet calls and time.Sleep, which cannot hold the required
+// sub-microsecond timing, and recvByte samples a single GPIO level per bit
+// rather than decoding the device's pulse width. It is experimental and not
+// expected to interoperate with a real SWI part; build with -tags swi to
+// include it.
+
+//go:build swi
+// +build swi
+
+package atecc608
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/f-secure-foundry/armoryctl/internal"
+)
+
+// SWI bit encoding, expressed as the low/high pulse widths (in
+// microseconds) of the single GPIO pin used for signaling.
+// (p49, 7.2 Single-Wire Interface, ATECC608A Full Datasheet)
+const (
+	swiZeroLow  = 7 * time.Microsecond
+	swiZeroHigh = 1 * time.Microsecond
+	swiOneLow   = 1 * time.Microsecond
+	swiOneHigh  = 7 * time.Microsecond
+	swiBitTime  = 8 * time.Microsecond
+)
+
+// SWITransport is a Transport implementation for ATECC608 parts wired for
+// the single-wire interface rather than I2C, bit-banging the protocol over
+// a single GPIO pin.
+//
+// EXPERIMENTAL: userspace GPIO bit-banging cannot reliably hold the SWI
+// bit cell's sub-microsecond timing; this implementation has not been
+// verified against real hardware and is built only with -tags swi.
+type SWITransport struct {
+	// Pin is the GPIO pin connected to the device's SDA/SWI line.
+	Pin int
+}
+
+func (t SWITransport) sendByte(b byte) error {
+	for i := 0; i < 8; i++ {
+		bit := (b >> uint(i)) & 0x01
+
+		if err := armoryctl.GPIOSet(t.Pin, true); err != nil {
+			return err
+		}
+
+		if bit == 0 {
+			time.Sleep(swiZeroLow)
+		} else {
+			time.Sleep(swiOneLow)
+		}
+
+		if err := armoryctl.GPIOSet(t.Pin, false); err != nil {
+			return err
+		}
+
+		if bit == 0 {
+			time.Sleep(swiZeroHigh)
+		} else {
+			time.Sleep(swiOneHigh)
+		}
+	}
+
+	return nil
+}
+
+func (t SWITransport) recvByte() (b byte, err error) {
+	for i := 0; i < 8; i++ {
+		high, err := armoryctl.GPIOGet(t.Pin)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if !high {
+			b |= 1 << uint(i)
+		}
+
+		time.Sleep(swiBitTime)
+	}
+
+	return
+}
+
+// Write implements Transport, framing data behind the SWI flag byte
+// matching word (0x77 command, 0xbb idle, 0xcc sleep, as per the
+// datasheet's SWI flag encoding).
+func (t SWITransport) Write(word uint8, data []byte) (err error) {
+	flag := swiFlag(word)
+
+	if err = t.sendByte(flag); err != nil {
+		return
+	}
+
+	for _, b := range data {
+		if err = t.sendByte(b); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Read implements Transport. Fetching a response always requires the
+// transmit flag, regardless of word, since the device has no notion of a
+// "read register" the way the I2C transport does.
+func (t SWITransport) Read(word uint8, n uint) (data []byte, err error) {
+	if err = t.sendByte(swiFlagTransmit); err != nil {
+		return
+	}
+
+	data = make([]byte, n)
+
+	for i := range data {
+		if data[i], err = t.recvByte(); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// SWI flag bytes.
+// (p50, Table 7-2, SWI Flag Byte, ATECC608A Full Datasheet)
+const (
+	swiFlagCommand  = 0x77
+	swiFlagTransmit = 0x88
+	swiFlagIdle     = 0xbb
+	swiFlagSleep    = 0xcc
+)
+
+// swiFlag maps an I2C-style word address onto the corresponding SWI flag
+// byte used to frame a Write. Reads always use swiFlagTransmit instead,
+// since fetching a response is never addressed by word.
+func swiFlag(word uint8) byte {
+	switch word {
+	case 0x01:
+		return swiFlagSleep
+	case 0x02:
+		return swiFlagIdle
+	default:
+		return swiFlagCommand
+	}
+}
+
+// Wake implements Transport, issuing the SWI wake-up sequence (holding the
+// line low for tWLO) rather than the I2C wake token.
+func (t SWITransport) Wake() (err error) {
+	if err = armoryctl.GPIOSet(t.Pin, true); err != nil {
+		return
+	}
+
+	time.Sleep(60 * time.Microsecond)
+
+	if err = armoryctl.GPIOSet(t.Pin, false); err != nil {
+		return
+	}
+
+	time.Sleep(CmdMaxExecutionTime * time.Millisecond)
+
+	res, err := t.Read(0x00, 4)
+
+	if err != nil {
+		return
+	}
+
+	_, err = verifyResponse(res)
+
+	if err != nil {
+		var statusErr *StatusError
+
+		if errors.As(err, &statusErr) && statusErr.Status == 0x11 {
+			err = nil
+		} else {
+			err = fmt.Errorf("wake-up failed")
+		}
+	}
+
+	return
+}
+
+// Idle implements Transport.
+func (t SWITransport) Idle() {
+	_ = t.Write(0x02, nil)
+}
+
+// Sleep implements Transport.
+func (t SWITransport) Sleep() {
+	_ = t.Write(0x01, nil)
+}
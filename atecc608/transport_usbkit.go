@@ -0,0 +1,166 @@
+// armoryctl | https://github.com/f-secure-foundry/armoryctl
+//
+// USB armory Mk II - hardware control tool
+// Copyright (c) F-Secure Corporation
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+//
+// Links:
+//   http://ww1.microchip.com/downloads/en/DeviceDoc/ATECC608A-CryptoAuthentication-Device-Summary-Data-Sheet-DS40001977B.pdf
+
+// This file pulls in a cgo-based HID dependency (github.com/karalabe/hid)
+// and is therefore excluded from the default build; build with -tags
+// usbkit to include it and add the dependency to go.mod.
+
+//go:build usbkit
+// +build usbkit
+
+package atecc608
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/karalabe/hid"
+)
+
+// CryptoAuth USB kit USB vendor/product identifiers.
+const (
+	kitVID = 0x04d8
+	kitPID = 0x00a5
+)
+
+// CryptoAuthKitTransport is a Transport implementation targeting a
+// Microchip CryptoAuth Trust Platform / USB development kit over HID,
+// framed with the kit's text-based "Kit Protocol". It lets the same
+// higher-level code developed against a kit on a workstation be
+// redeployed unmodified against the USB armory's I2CTransport.
+type CryptoAuthKitTransport struct {
+	device *hid.Device
+}
+
+// OpenCryptoAuthKit opens the first attached Microchip CryptoAuth USB kit
+// and returns a Transport backed by it.
+func OpenCryptoAuthKit() (t *CryptoAuthKitTransport, err error) {
+	infos, err := hid.Enumerate(kitVID, kitPID)
+
+	if err != nil {
+		return
+	}
+
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("no CryptoAuth USB kit found")
+	}
+
+	device, err := infos[0].Open()
+
+	if err != nil {
+		return
+	}
+
+	return &CryptoAuthKitTransport{device: device}, nil
+}
+
+// Close releases the underlying HID device.
+func (t *CryptoAuthKitTransport) Close() error {
+	return t.device.Close()
+}
+
+// kitOpcode maps an I2C-style word address onto the Kit Protocol's
+// single-character send opcode.
+func kitOpcode(word uint8) byte {
+	switch word {
+	case CmdAddress:
+		return 't' // talk: send a command frame
+	case 0x00:
+		return 'w' // wake
+	case 0x01:
+		return 's' // sleep
+	case 0x02:
+		return 'i' // idle
+	default:
+		return 't'
+	}
+}
+
+// kitFrame builds a Kit Protocol send packet: opcode, ':', hex-encoded
+// payload, newline.
+func kitFrame(word uint8, data []byte) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteByte(kitOpcode(word))
+	buf.WriteByte(':')
+	buf.WriteString(hex.EncodeToString(data))
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+// Write implements Transport.
+func (t *CryptoAuthKitTransport) Write(word uint8, data []byte) error {
+	_, err := t.device.Write(kitFrame(word, data))
+	return err
+}
+
+// Read implements Transport.
+func (t *CryptoAuthKitTransport) Read(word uint8, n uint) (data []byte, err error) {
+	buf := make([]byte, 2*n+1)
+
+	read, err := t.device.Read(buf)
+
+	if err != nil {
+		return
+	}
+
+	decoded, err := hex.DecodeString(string(bytes.TrimSpace(buf[:read])))
+
+	if err != nil {
+		return
+	}
+
+	if uint(len(decoded)) > n {
+		decoded = decoded[:n]
+	}
+
+	return decoded, nil
+}
+
+// Wake implements Transport.
+func (t *CryptoAuthKitTransport) Wake() (err error) {
+	if err = t.Write(0x00, nil); err != nil {
+		return
+	}
+
+	res, err := t.Read(0x00, 4)
+
+	if err != nil {
+		return
+	}
+
+	_, err = verifyResponse(res)
+
+	if err != nil {
+		// Status 0x11 ("after wake, prior to first command") is the
+		// expected response right after waking up, not a failure.
+		var statusErr *StatusError
+
+		if errors.As(err, &statusErr) && statusErr.Status == 0x11 {
+			err = nil
+		}
+	}
+
+	return
+}
+
+// Idle implements Transport.
+func (t *CryptoAuthKitTransport) Idle() {
+	_ = t.Write(0x02, nil)
+}
+
+// Sleep implements Transport.
+func (t *CryptoAuthKitTransport) Sleep() {
+	_ = t.Write(0x01, nil)
+}
@@ -0,0 +1,6 @@
+package armoryctl
+
+func I2CWrite(bus int, addr int, reg uint8, data []byte) error { return nil }
+func I2CRead(bus int, addr int, reg uint8, n uint) ([]byte, error) { return make([]byte, n), nil }
+func GPIOSet(pin int, value bool) error { return nil }
+func GPIOGet(pin int) (bool, error) { return false, nil }